@@ -3,34 +3,123 @@ package container
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"go-mesos-executor/errdefs"
+	"go-mesos-executor/logger"
+
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/containers"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/oci"
-	"go-mesos-executor/logger"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 	"go.uber.org/zap"
-	"net"
-	"syscall"
 )
 
+// containerdHandle retains the containerd objects obtained for a container
+// across its lifecycle, so that lifecycle calls don't need to reload them
+// from containerd on every RPC. Its exit status is read from containerd
+// exactly once by a watcher goroutine started in ContainerRun, then
+// broadcast to every ContainerWait/ContainerStop caller through done.
+type containerdHandle struct {
+	container containerd.Container
+
+	// mu guards task, done, status and cancel below: they are written once
+	// by ContainerRun and its exit-status watcher goroutine, and read by
+	// every other lifecycle call, so access needs to be synchronized
+	// independently of c.mu (which only protects the handles map)
+	mu     sync.Mutex
+	task   containerd.Task
+	done   chan struct{}
+	status containerd.ExitStatus
+	cancel context.CancelFunc
+}
+
+func (h *containerdHandle) setRunning(task containerd.Task, cancel context.CancelFunc, done chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.task = task
+	h.cancel = cancel
+	h.done = done
+}
+
+func (h *containerdHandle) setStatus(status containerd.ExitStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+// getTask returns the handle's task and its associated done channel, or a
+// nil task if the container has not been run yet
+func (h *containerdHandle) getTask() (containerd.Task, chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.task, h.done
+}
+
+func (h *containerdHandle) getStatus() containerd.ExitStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+func (h *containerdHandle) getCancel() context.CancelFunc {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cancel
+}
+
 type ContainerdContainerizer struct {
 	Client *containerd.Client
 
-	Image string
+	Image     string
 	Namespace string
 
+	mu      sync.Mutex
+	handles map[string]*containerdHandle
 }
 
 
 func NewContainerdContainerizer(socket, image, namespace  string) (*ContainerdContainerizer, error) {
 	client, err := containerd.New(socket)
 	if err != nil {
-		return nil, err
+		return nil, errdefs.Unavailable(err)
 	}
 
-	return &ContainerdContainerizer{Client: client, Image: image, Namespace: namespace}, nil
+	return &ContainerdContainerizer{
+		Client:    client,
+		Image:     image,
+		Namespace: namespace,
+		handles:   make(map[string]*containerdHandle),
+	}, nil
 }
 
+func (c *ContainerdContainerizer) setHandle(id string, h *containerdHandle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handles[id] = h
+}
+
+func (c *ContainerdContainerizer) getHandle(id string) (*containerdHandle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.handles[id]
+	return h, ok
+}
+
+func (c *ContainerdContainerizer) deleteHandle(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.handles, id)
+}
 
 func (c *ContainerdContainerizer) ContainerCreate(info Info) (string, error){
 
@@ -46,36 +135,79 @@ func (c *ContainerdContainerizer) ContainerCreate(info Info) (string, error){
 		image, err = c.Client.Pull(ctx, c.Image, containerd.WithPullUnpack)
 		if err != nil {
 			logger.GetInstance().Error("pull images failed", zap.Error(err))
-			return "", err
+			return "", errdefs.Unavailable(err)
+		}
+	}
+
+	// resources applies the CPU/memory limits carried by Info to the OCI spec.
+	// Optional CPU quota/period are read from viper since Info has no field for them.
+	memoryLimit := int64(info.MemoryLimit * 1024 * 1024)
+	cpuShares := info.CPUSharesLimit * 1024
+	resources := func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
 		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+
+		// a zero Info.MemoryLimit/CPUSharesLimit means "not set", not
+		// "limit to zero" - leave the OCI spec's own defaults in that case
+		// instead of guaranteeing an OOM-kill or starving the container of CPU
+		if info.MemoryLimit > 0 {
+			s.Linux.Resources.Memory = &specs.LinuxMemory{
+				Limit: &memoryLimit,
+			}
+		}
+		quota := viper.GetInt64("containerd.cpu_quota")
+		period := viper.GetUint64("containerd.cpu_period")
+
+		if info.CPUSharesLimit > 0 || quota > 0 || period > 0 {
+			if s.Linux.Resources.CPU == nil {
+				s.Linux.Resources.CPU = &specs.LinuxCPU{}
+			}
+			if info.CPUSharesLimit > 0 {
+				s.Linux.Resources.CPU.Shares = &cpuShares
+			}
+			if quota > 0 {
+				s.Linux.Resources.CPU.Quota = &quota
+			}
+			if period > 0 {
+				s.Linux.Resources.CPU.Period = &period
+			}
+		}
+
+		return nil
 	}
 
+	// securityLabels carries the container's SELinux/AppArmor labels, set by
+	// the selinux hook on Info before ContainerCreate is called, onto the OCI spec
+	securityLabels := func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
+		if info.ProcessLabel != "" || info.AppArmorProfile != "" {
+			if s.Process == nil {
+				s.Process = &specs.Process{}
+			}
+			s.Process.SelinuxLabel = info.ProcessLabel
+			s.Process.ApparmorProfile = info.AppArmorProfile
+		}
 
-	//memorylimit := int64(info.MemoryLimit *1024 * 1024)
-	//cpushare := info.CPUSharesLimit * 1024
-	//resources := func(_ context.Context, _ oci.Client, _ *containers.Container, s *specs.Spec) error {
-	//	s.Linux.Resources.Memory = &specs.LinuxMemory{
-	//		Limit: &memorylimit,
-	//	}
-	//	s.Linux.Resources.CPU = &specs.LinuxCPU{
-	//		Shares: &cpushare,
-	//	}
-	//	return nil
-	//}
+		if info.MountLabel != "" {
+			if s.Linux == nil {
+				s.Linux = &specs.Linux{}
+			}
+			s.Linux.MountLabel = info.MountLabel
+		}
 
-	//container, err := c.Client.NewContainer(
-	//	ctx,
-	//	id,
-	//	containerd.WithImage(image),
-	//	containerd.WithNewSnapshot(id, image),
-	//	containerd.WithNewSpec(oci.WithImageConfig(image), resources),
-	//)
+		return nil
+	}
 
 	containerOpts :=[]containerd.NewContainerOpts{}
 	if image != nil {
 		containerOpts= append(containerOpts, containerd.WithImage(image))
 		containerOpts = append(containerOpts, containerd.WithNewSnapshot(id, image))
-		containerOpts = append(containerOpts, containerd.WithNewSpec(oci.WithImageConfig(image)))
+		containerOpts = append(containerOpts, containerd.WithNewSpec(oci.WithImageConfig(image), resources, securityLabels))
+	} else {
+		containerOpts = append(containerOpts, containerd.WithNewSpec(resources, securityLabels))
 	}
 
 	// create a container
@@ -83,16 +215,15 @@ func (c *ContainerdContainerizer) ContainerCreate(info Info) (string, error){
 		ctx,
 		id,
 		containerOpts ...
-		//containerd.WithImage(image),
-		//containerd.WithNewSnapshot(id, image),
-		//containerd.WithNewSpec(oci.WithImageConfig(image)),
 	)
 
 	if err != nil {
 		logger.GetInstance().Error("create container failed ", zap.Error(err))
-		return "", err
+		return "", errdefs.System(err)
 	}
 
+	c.setHandle(container.ID(), &containerdHandle{container: container})
+
 	logger.GetInstance().Info("task created ", zap.String("ID", container.ID()))
 
 	return container.ID(), nil
@@ -103,22 +234,40 @@ func (c *ContainerdContainerizer) ContainerRun(id string) error {
 	// create a new context with namespace
 	ctx := namespaces.WithNamespace(context.Background(), c.Namespace)
 
-	container, err:= c.Client.LoadContainer(ctx, id)
-	if err != nil {
-		logger.GetInstance().Error("get container from id failed", zap.String("id", id), zap.Error(err))
-		return err
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Error("no container handle found for id", zap.String("id", id))
+		return errdefs.NotFound(fmt.Errorf("no container handle found for id %s", id))
 	}
 
 	// create a task from the container
-	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStdio))
+	task, err := h.container.NewTask(ctx, cio.NewCreator(cio.WithStdio))
 	if err != nil {
 		logger.GetInstance().Error("create task failed ", zap.Error(err))
-		return err
+		return errdefs.System(err)
 	}
 
+	// watch the task exit status exactly once, broadcasting it to every
+	// ContainerWait/ContainerStop caller through h.done
+	watchCtx, cancel := context.WithCancel(namespaces.WithNamespace(context.Background(), c.Namespace))
+	exitStatusC, err := task.Wait(watchCtx)
+	if err != nil {
+		cancel()
+		logger.GetInstance().Error("watch task exit status failed ", zap.Error(err))
+		return errdefs.System(err)
+	}
+
+	done := make(chan struct{})
+	h.setRunning(task, cancel, done)
+
+	go func() {
+		h.setStatus(<-exitStatusC)
+		close(done)
+	}()
+
 	if err := task.Start(ctx); err != nil {
 		logger.GetInstance().Error("start task failed ", zap.Error(err))
-		return err
+		return errdefs.System(err)
 	}
 
 	return nil
@@ -127,28 +276,23 @@ func (c *ContainerdContainerizer) ContainerRun(id string) error {
 // ContainerWait waits for the given container to stop and returns its
 // exit code. This function is blocking.
 func (c *ContainerdContainerizer) ContainerWait(id string) (int, error) {
-
-	// create a new context with namespace
-	ctx := namespaces.WithNamespace(context.Background(), c.Namespace)
-
-	container, err:= c.Client.LoadContainer(ctx, id)
-	if err != nil {
-		logger.GetInstance().Error("get container from id failed", zap.String("id", id), zap.Error(err))
-		return -1, err
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		return -1, errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
 	}
 
-	task, err := container.Task(ctx, nil)
-	if err != nil {
-		logger.GetInstance().Error("get task from id failed", zap.String("id", id), zap.Error(err))
-		return -1, err
+	task, done := h.getTask()
+	if task == nil {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		return -1, errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
 	}
 
-	exitStatusC, _ := task.Wait(ctx)
-	status := <-exitStatusC
-	code, _, err := status.Result()
+	<-done
+	code, _, err := h.getStatus().Result()
 	if err != nil {
 		logger.GetInstance().Error("get task exit status error ", zap.Error(err))
-		return -1, err
+		return -1, errdefs.System(err)
 	}
 
 	return int(code), nil
@@ -156,48 +300,48 @@ func (c *ContainerdContainerizer) ContainerWait(id string) (int, error) {
 
 //stop the given container
 func (c *ContainerdContainerizer) ContainerStop(id string) error {
-	// create a new context with  namespace
 	ctx := namespaces.WithNamespace(context.Background(), c.Namespace)
 
-	container, err:= c.Client.LoadContainer(ctx, id)
-	if err != nil {
-		logger.GetInstance().Warn("get container from id failed", zap.String("id", id), zap.Error(err))
-		return  nil
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Warn("no running task found for id, nothing to stop", zap.String("id", id))
+		return nil
 	}
 
-	task, err := container.Task(ctx, nil)
-	if err != nil {
-		logger.GetInstance().Warn("get task from id failed", zap.String("id", id), zap.Error(err))
+	task, done := h.getTask()
+	if task == nil {
+		logger.GetInstance().Warn("no running task found for id, nothing to stop", zap.String("id", id))
 		return nil
 	}
 
-	logger.GetInstance().Info(fmt.Sprintf("task info is %v", task))
-	taskstatus,_:=task.Status(ctx)
-	if taskstatus.Status != containerd.Stopped{
+	taskstatus, _ := task.Status(ctx)
+	if taskstatus.Status != containerd.Stopped {
 
 		logger.GetInstance().Info(fmt.Sprintf("task %s status %v is not stopped, need to kill first", id, taskstatus.Status))
 
-		exitStatusC, _ := task.Wait(ctx)
-
-		// kill the task first
+		// the exit status watcher started in ContainerRun is already waiting
+		// on the task, so waiting on done after the kill cannot deadlock. If
+		// the task exited on its own between the status check and the kill,
+		// Kill fails and ContainerStop returns that error
 		if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
 			logger.GetInstance().Error("kill task by id failed", zap.String("id", id), zap.Error(err))
-			return err
+			return errdefs.System(err)
 		}
 
-		status := <-exitStatusC
-		code, _, err := status.Result()
+		<-done
+		code, _, err := h.getStatus().Result()
 		if err != nil {
-			return err
+			return errdefs.System(err)
 		}
 
 		logger.GetInstance().Info("task killed with status", zap.String("id", id), zap.Int("status", int(code)))
 	}
+
 	//stopped task can be delete directly
-	_, errt:=task.Delete(ctx)
+	_, errt := task.Delete(ctx)
 	if errt != nil {
 		logger.GetInstance().Error("task delete failed", zap.String("id", id), zap.Error(errt))
-		return errt
+		return errdefs.System(errt)
 	}
 
 	logger.GetInstance().Info("task deleted ", zap.String("id", id))
@@ -210,33 +354,182 @@ func (c *ContainerdContainerizer) ContainerRemove(id string) error {
 	// create a new context with namespace
 	ctx := namespaces.WithNamespace(context.Background(), c.Namespace)
 
-	container, err:= c.Client.LoadContainer(ctx, id)
-	if err != nil {
-		logger.GetInstance().Warn("get container from id failed", zap.String("id", id), zap.Error(err))
-		return  err
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Warn("no container handle found for id", zap.String("id", id))
+		return errdefs.NotFound(fmt.Errorf("no container handle found for id %s", id))
 	}
 
 	//delete container
-	if err:= container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+	if err := h.container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
 		logger.GetInstance().Error("delete container by id failed", zap.String("id", id), zap.Error(err))
-		return err
+		return errdefs.System(err)
 	}
 
+	if cancel := h.getCancel(); cancel != nil {
+		cancel()
+	}
+	c.deleteHandle(id)
+
 	logger.GetInstance().Info("container deleted ", zap.String("id", id))
 	return nil
 }
 
+// ContainerGetPID returns the PID of the container's task, as seen from the host
 func (c *ContainerdContainerizer) ContainerGetPID(id string) (int, error) {
-	return -1, nil
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		return -1, errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
+	}
+
+	task, _ := h.getTask()
+	if task == nil {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		return -1, errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
+	}
+
+	return int(task.Pid()), nil
 }
 
-func (c *ContainerdContainerizer) ContainerExec(ctx context.Context, id string, cmd []string) (chan error)  {
-	return nil
+// ContainerExec runs the given command inside the container's task and returns
+// a channel that will receive the command result once it has completed.
+func (c *ContainerdContainerizer) ContainerExec(ctx context.Context, id string, cmd []string) chan error {
+	result := make(chan error, 1)
+
+	h, ok := c.getHandle(id)
+	if !ok {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		result <- errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
+		return result
+	}
+
+	task, _ := h.getTask()
+	if task == nil {
+		logger.GetInstance().Error("no running task found for id", zap.String("id", id))
+		result <- errdefs.NotFound(fmt.Errorf("no running task found for id %s", id))
+		return result
+	}
+
+	execCtx := namespaces.WithNamespace(ctx, c.Namespace)
+
+	spec, err := h.container.Spec(execCtx)
+	if err != nil {
+		logger.GetInstance().Error("get container spec failed", zap.String("id", id), zap.Error(err))
+		result <- errdefs.System(err)
+		return result
+	}
+
+	processSpec := *spec.Process
+	processSpec.Args = cmd
+	processSpec.Terminal = false
+
+	execID := fmt.Sprintf("exec-%d", rand.Int63())
+
+	process, err := task.Exec(execCtx, execID, &processSpec, cio.NullIO)
+	if err != nil {
+		logger.GetInstance().Error("exec in task failed", zap.String("id", id), zap.Error(err))
+		result <- errdefs.System(err)
+		return result
+	}
+
+	exitStatusC, err := process.Wait(execCtx)
+	if err != nil {
+		logger.GetInstance().Error("wait on exec process failed", zap.String("id", id), zap.Error(err))
+		result <- errdefs.System(err)
+		return result
+	}
+
+	if err := process.Start(execCtx); err != nil {
+		logger.GetInstance().Error("start exec process failed", zap.String("id", id), zap.Error(err))
+		result <- errdefs.System(err)
+		return result
+	}
+
+	go func() {
+		var resultErr error
+
+		select {
+		case status := <-exitStatusC:
+			_, _, resultErr = status.Result()
+		case <-execCtx.Done():
+			// the probe's context expired before the process exited on its
+			// own; kill it so it doesn't keep running, then wait for the
+			// exit status so Delete below doesn't race a still-running process
+			killCtx := namespaces.WithNamespace(context.Background(), c.Namespace)
+			if err := process.Kill(killCtx, syscall.SIGKILL); err != nil {
+				logger.GetInstance().Error("kill exec process failed", zap.String("id", id), zap.Error(err))
+			}
+			<-exitStatusC
+			resultErr = execCtx.Err()
+		}
+
+		// delete the exec process handle, the same way ContainerStop deletes
+		// the task after it exits, otherwise every exec leaks a process
+		// object in the containerd shim
+		delCtx := namespaces.WithNamespace(context.Background(), c.Namespace)
+		if _, err := process.Delete(delCtx); err != nil {
+			logger.GetInstance().Error("delete exec process failed", zap.String("id", id), zap.Error(err))
+		}
+
+		result <- resultErr
+	}()
+
+	return result
 }
 
+// ContainerGetIPsByInterface enters the container's network namespace and
+// returns the addresses bound to the given interface.
 func (c *ContainerdContainerizer) ContainerGetIPsByInterface(id string, interfaceName string) ([]net.IP,  error){
-	return nil, nil
-}
+	pid, err := c.ContainerGetPID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	containerNs, err := netns.GetFromPath(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		logger.GetInstance().Error("get container network namespace failed", zap.String("id", id), zap.Error(err))
+		return nil, errdefs.System(err)
+	}
+	defer containerNs.Close()
 
+	hostNs, err := netns.Get()
+	if err != nil {
+		logger.GetInstance().Error("get host network namespace failed", zap.Error(err))
+		return nil, errdefs.System(err)
+	}
+	defer hostNs.Close()
+
+	// Pin this goroutine to its OS thread for the lifetime of the namespace
+	// switch: netns.Set changes the namespace of the calling OS thread, and
+	// without locking the Go scheduler could move this goroutine off (or
+	// move another goroutine onto) that thread while it's still sitting in
+	// the container's namespace.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := netns.Set(containerNs); err != nil {
+		logger.GetInstance().Error("enter container network namespace failed", zap.String("id", id), zap.Error(err))
+		return nil, errdefs.System(err)
+	}
+	defer netns.Set(hostNs)
 
+	link, err := netlink.LinkByName(interfaceName)
+	if err != nil {
+		logger.GetInstance().Error("get interface failed", zap.String("id", id), zap.String("interface", interfaceName), zap.Error(err))
+		return nil, errdefs.NotFound(err)
+	}
 
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		logger.GetInstance().Error("list addresses failed", zap.String("id", id), zap.String("interface", interfaceName), zap.Error(err))
+		return nil, errdefs.System(err)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, nil
+}
@@ -24,4 +24,11 @@ type Info struct {
 	MemoryLimit    uint64
 	Name          string
 	TaskInfo       mesos.TaskInfo
+
+	// MountLabel is the SELinux label applied to volumes mounted into the container
+	MountLabel string
+	// ProcessLabel is the SELinux label the container's process runs under
+	ProcessLabel string
+	// AppArmorProfile is the name of the AppArmor profile confining the container's process
+	AppArmorProfile string
 }
@@ -0,0 +1,156 @@
+// Package errdefs defines the error interfaces that callers can use to
+// understand the cause of an error returned by the executor without string
+// matching, so that it can be mapped to the correct Mesos task status.
+package errdefs
+
+// ErrNotFound signals that the requested object does not exist
+type ErrNotFound interface {
+	NotFound()
+}
+
+// ErrInvalidParameter signals that the user input or configuration is invalid
+type ErrInvalidParameter interface {
+	InvalidParameter()
+}
+
+// ErrConflict signals that the requested operation can't be completed
+// because of a conflict with the current state of the target resource
+type ErrConflict interface {
+	Conflict()
+}
+
+// ErrUnavailable signals that the requested action could not be completed
+// because a dependency is currently unreachable or not ready. This is
+// typically a transient condition that may succeed if retried
+type ErrUnavailable interface {
+	Unavailable()
+}
+
+// ErrSystem signals an unexpected, unrecoverable error
+type ErrSystem interface {
+	System()
+}
+
+// causer is implemented by github.com/pkg/errors wrapped errors
+type causer interface {
+	Cause() error
+}
+
+// isErr unwraps err through its causer chain, looking for an error
+// matching the given predicate
+func isErr(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+
+		cause, ok := err.(causer)
+		if !ok {
+			return false
+		}
+
+		err = cause.Cause()
+	}
+
+	return false
+}
+
+// IsNotFound returns true if err, or any error it wraps, is an ErrNotFound
+func IsNotFound(err error) bool {
+	return isErr(err, func(err error) bool {
+		_, ok := err.(ErrNotFound)
+		return ok
+	})
+}
+
+// IsInvalidParameter returns true if err, or any error it wraps, is an ErrInvalidParameter
+func IsInvalidParameter(err error) bool {
+	return isErr(err, func(err error) bool {
+		_, ok := err.(ErrInvalidParameter)
+		return ok
+	})
+}
+
+// IsConflict returns true if err, or any error it wraps, is an ErrConflict
+func IsConflict(err error) bool {
+	return isErr(err, func(err error) bool {
+		_, ok := err.(ErrConflict)
+		return ok
+	})
+}
+
+// IsUnavailable returns true if err, or any error it wraps, is an ErrUnavailable
+func IsUnavailable(err error) bool {
+	return isErr(err, func(err error) bool {
+		_, ok := err.(ErrUnavailable)
+		return ok
+	})
+}
+
+// IsSystem returns true if err, or any error it wraps, is an ErrSystem
+func IsSystem(err error) bool {
+	return isErr(err, func(err error) bool {
+		_, ok := err.(ErrSystem)
+		return ok
+	})
+}
+
+type notFoundErr struct{ error }
+
+func (notFoundErr) NotFound() {}
+
+// NotFound wraps err so that IsNotFound(err) returns true. Returns nil if err is nil
+func NotFound(err error) error {
+	if err == nil {
+		return nil
+	}
+	return notFoundErr{err}
+}
+
+type invalidParameterErr struct{ error }
+
+func (invalidParameterErr) InvalidParameter() {}
+
+// InvalidParameter wraps err so that IsInvalidParameter(err) returns true. Returns nil if err is nil
+func InvalidParameter(err error) error {
+	if err == nil {
+		return nil
+	}
+	return invalidParameterErr{err}
+}
+
+type conflictErr struct{ error }
+
+func (conflictErr) Conflict() {}
+
+// Conflict wraps err so that IsConflict(err) returns true. Returns nil if err is nil
+func Conflict(err error) error {
+	if err == nil {
+		return nil
+	}
+	return conflictErr{err}
+}
+
+type unavailableErr struct{ error }
+
+func (unavailableErr) Unavailable() {}
+
+// Unavailable wraps err so that IsUnavailable(err) returns true. Returns nil if err is nil
+func Unavailable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return unavailableErr{err}
+}
+
+type systemErr struct{ error }
+
+func (systemErr) System() {}
+
+// System wraps err so that IsSystem(err) returns true. Returns nil if err is nil
+func System(err error) error {
+	if err == nil {
+		return nil
+	}
+	return systemErr{err}
+}
@@ -0,0 +1,77 @@
+package errdefs
+
+import (
+	"errors"
+	"testing"
+)
+
+// wrappedErr is a minimal stand-in for a github.com/pkg/errors wrapped
+// error: it satisfies the causer interface without adding a dependency
+type wrappedErr struct {
+	error
+	cause error
+}
+
+func (w wrappedErr) Cause() error { return w.cause }
+
+func TestIsPredicatesMatchDirectErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		wrap func(error) error
+		is   func(error) bool
+	}{
+		{"NotFound", NotFound, IsNotFound},
+		{"InvalidParameter", InvalidParameter, IsInvalidParameter},
+		{"Conflict", Conflict, IsConflict},
+		{"Unavailable", Unavailable, IsUnavailable},
+		{"System", System, IsSystem},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.wrap(errors.New("boom"))
+			if !c.is(err) {
+				t.Errorf("expected %s to report true for its own error", c.name)
+			}
+		})
+	}
+}
+
+func TestIsPredicatesRejectOtherKinds(t *testing.T) {
+	err := NotFound(errors.New("boom"))
+
+	if IsInvalidParameter(err) || IsConflict(err) || IsUnavailable(err) || IsSystem(err) {
+		t.Error("expected a NotFound error to not match any other predicate")
+	}
+}
+
+func TestIsPredicatesUnwrapCausedErrors(t *testing.T) {
+	cause := NotFound(errors.New("missing"))
+	wrapped := wrappedErr{error: errors.New("looking up container"), cause: cause}
+
+	if !IsNotFound(wrapped) {
+		t.Error("expected IsNotFound to unwrap through a Cause chain")
+	}
+}
+
+func TestIsPredicatesReturnFalseForPlainErrors(t *testing.T) {
+	if IsNotFound(errors.New("boom")) {
+		t.Error("expected a plain error to not match IsNotFound")
+	}
+}
+
+func TestWrapFunctionsReturnNilForNil(t *testing.T) {
+	wrappers := map[string]func(error) error{
+		"NotFound":         NotFound,
+		"InvalidParameter": InvalidParameter,
+		"Conflict":         Conflict,
+		"Unavailable":      Unavailable,
+		"System":           System,
+	}
+
+	for name, wrap := range wrappers {
+		if err := wrap(nil); err != nil {
+			t.Errorf("%s(nil) = %v, want nil", name, err)
+		}
+	}
+}
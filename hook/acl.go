@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"go-mesos-executor/container"
+	"go-mesos-executor/errdefs"
 	"go-mesos-executor/logger"
 	"github.com/spf13/viper"
 
@@ -39,7 +40,7 @@ var ACLHook = Hook{
 
 		driver, err := iptables.New()
 		if err != nil {
-			return err
+			return errdefs.Unavailable(err)
 		}
 
 		chain, err := checkChain(driver)
@@ -61,7 +62,7 @@ var ACLHook = Hook{
 
 		driver, err := iptables.New()
 		if err != nil {
-			return err
+			return errdefs.Unavailable(err)
 		}
 
 		chain, err := checkChain(driver)
@@ -82,16 +83,16 @@ func checkChain(driver *iptables.IPTables) (string, error) {
 	// Get acl chain
 	aclChain := viper.GetString("acl.chain")
 	if aclChain == "" {
-		return "", fmt.Errorf("no iptables chain set for acl hook")
+		return "", errdefs.InvalidParameter(fmt.Errorf("no iptables chain set for acl hook"))
 	}
 
 	if aclChain == "FORWARD" || aclChain == "OUTPUT" {
-		return "", fmt.Errorf("forward and ouput chains cannot be used for acl injection")
+		return "", errdefs.InvalidParameter(fmt.Errorf("forward and ouput chains cannot be used for acl injection"))
 	}
 
 	chains, err := driver.ListChains("filter")
 	if err != nil {
-		return "", err
+		return "", errdefs.Unavailable(err)
 	}
 
 	for i := range chains {
@@ -100,7 +101,7 @@ func checkChain(driver *iptables.IPTables) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("Chain %s does not exists", aclChain)
+	return "", errdefs.InvalidParameter(fmt.Errorf("Chain %s does not exists", aclChain))
 }
 
 // generateACL generates all needed iptables for access control.
@@ -138,16 +139,16 @@ func generateACL(
 		if len(match) > 1 {
 			portIndex, err = strconv.Atoi(match[1])
 			if err != nil {
-				return fmt.Errorf("Port index %d is not valid", portIndex)
+				return errdefs.InvalidParameter(fmt.Errorf("Port index %d is not valid", portIndex))
 			}
 		} else {
-			return fmt.Errorf("Could not retrieve port index")
+			return errdefs.InvalidParameter(fmt.Errorf("Could not retrieve port index"))
 		}
 
 		if len(portMappings) > portIndex {
 			portMapping = portMappings[portIndex]
 		} else {
-			return fmt.Errorf("Port index %d does not match port mapping definition", portIndex)
+			return errdefs.InvalidParameter(fmt.Errorf("Port index %d does not match port mapping definition", portIndex))
 		}
 
 		// Expected label value is a list of IP (with or without CIDR): 1.1.1.0/24,2.3.4.5,...
@@ -167,7 +168,7 @@ func generateACL(
 				continue
 			}
 
-			return fmt.Errorf("Invalid IP: %s", ip)
+			return errdefs.InvalidParameter(fmt.Errorf("Invalid IP: %s", ip))
 		}
 
 		logger.GetInstance().Info("Injecting iptables rules",
@@ -186,7 +187,7 @@ func generateACL(
 			err = action("filter", chain, strings.Split(aclRule, " ")...)
 			if err != nil {
 				if stopOnError {
-					return fmt.Errorf("Error while injecting acl iptables rule: %v", err)
+					return errdefs.System(fmt.Errorf("Error while injecting acl iptables rule: %v", err))
 				}
 			}
 		}
@@ -207,7 +208,7 @@ func generateACL(
 				err = action("filter", chain, strings.Split(aclRule, " ")...)
 				if err != nil {
 					if stopOnError {
-						return fmt.Errorf("Error while injecting acl iptables rule: %v", err)
+						return errdefs.System(fmt.Errorf("Error while injecting acl iptables rule: %v", err))
 					}
 				}
 			}
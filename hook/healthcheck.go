@@ -0,0 +1,305 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-mesos-executor/container"
+	"go-mesos-executor/logger"
+
+	"github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHealthcheckInterval       = 10 * time.Second
+	defaultHealthcheckTimeout        = time.Second
+	defaultHealthcheckRetries        = 3
+	defaultHealthcheckExpectedStatus = http.StatusOK
+)
+
+// healthcheckStatusC carries a HealthcheckStatus for each container that just
+// crossed its configured healthcheck retries threshold. It is read through
+// HealthcheckStatusC
+var healthcheckStatusC = make(chan HealthcheckStatus, 32)
+
+// HealthcheckStatusC exposes healthcheckStatusC so the executor can consume
+// healthcheck failures and turn them into a TASK_FAILED update
+var HealthcheckStatusC <-chan HealthcheckStatus = healthcheckStatusC
+
+// HealthcheckStatus describes a container that has reached its configured
+// number of consecutive healthcheck failures
+type HealthcheckStatus struct {
+	ContainerID string
+	TaskInfo    *mesos.TaskInfo
+	Reason      string
+}
+
+var (
+	healthcheckProbesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "executor_healthcheck_probes_total",
+			Help: "Total number of healthcheck probes run, per container and outcome",
+		},
+		[]string{"container_id", "outcome"},
+	)
+	healthcheckHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "executor_healthcheck_healthy",
+			Help: "Whether the last healthcheck probe for a container succeeded (1) or not (0)",
+		},
+		[]string{"container_id"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(healthcheckProbesTotal, healthcheckHealthy)
+}
+
+// healthchecks tracks the running probe goroutines so PreStop can cancel
+// them and wait for them to actually exit before returning
+var healthchecks = &healthcheckRegistry{entries: make(map[string]healthcheckEntry)}
+
+type healthcheckEntry struct {
+	cancel context.CancelFunc
+	// done is closed by the probe goroutine once runHealthcheckLoop has
+	// observed cancellation and returned
+	done chan struct{}
+}
+
+type healthcheckRegistry struct {
+	mu      sync.Mutex
+	entries map[string]healthcheckEntry
+}
+
+func (r *healthcheckRegistry) start(id string, cancel context.CancelFunc, done chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[id] = healthcheckEntry{cancel: cancel, done: done}
+}
+
+// stop cancels the probe loop running for id, if any, and blocks until it
+// has exited so no probe is still in flight once stop returns
+func (r *healthcheckRegistry) stop(id string) {
+	r.mu.Lock()
+	entry, ok := r.entries[id]
+	delete(r.entries, id)
+	r.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	entry.cancel()
+	<-entry.done
+}
+
+// healthcheckProbe is the probe configuration read from task labels
+type healthcheckProbe struct {
+	kind           string
+	cmd            []string
+	target         string
+	expectedStatus int
+	interval       time.Duration
+	timeout        time.Duration
+	retries        int
+	startPeriod    time.Duration
+}
+
+// HealthcheckHook starts a probe goroutine on post-run for any task carrying
+// an EXECUTOR_HEALTHCHECK_TYPE label, and stops it on pre-stop
+var HealthcheckHook = Hook{
+	Name:     "healthcheck",
+	Priority: 0,
+	RunPostRun: func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error {
+		probe, ok := parseHealthcheckProbe(taskInfo)
+		if !ok {
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		healthchecks.start(containerID, cancel, done)
+
+		go func() {
+			defer close(done)
+			runHealthcheckLoop(ctx, c, taskInfo, containerID, probe)
+		}()
+
+		return nil
+	},
+	// RunPreStop cancels the container's probe goroutine and waits for it
+	// to exit before returning, so no probe is still in flight against a
+	// container that's about to be torn down
+	RunPreStop: func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error {
+		healthchecks.stop(containerID)
+		return nil
+	},
+}
+
+// parseHealthcheckProbe reads probe configuration from the task's
+// EXECUTOR_HEALTHCHECK_* labels. It returns false if the task does not
+// request a healthcheck
+func parseHealthcheckProbe(taskInfo *mesos.TaskInfo) (healthcheckProbe, bool) {
+	labels := make(map[string]string)
+	for _, label := range taskInfo.GetLabels().GetLabels() {
+		labels[label.GetKey()] = label.GetValue()
+	}
+
+	kind, ok := labels["EXECUTOR_HEALTHCHECK_TYPE"]
+	if !ok {
+		return healthcheckProbe{}, false
+	}
+
+	probe := healthcheckProbe{
+		kind:           kind,
+		expectedStatus: defaultHealthcheckExpectedStatus,
+		interval:       defaultHealthcheckInterval,
+		timeout:        defaultHealthcheckTimeout,
+		retries:        defaultHealthcheckRetries,
+	}
+
+	if cmd, ok := labels["EXECUTOR_HEALTHCHECK_CMD"]; ok {
+		probe.cmd = strings.Fields(cmd)
+	}
+
+	probe.target = labels["EXECUTOR_HEALTHCHECK_URL"]
+
+	if v, err := time.ParseDuration(labels["EXECUTOR_HEALTHCHECK_INTERVAL"]); err == nil {
+		probe.interval = v
+	}
+	if v, err := time.ParseDuration(labels["EXECUTOR_HEALTHCHECK_TIMEOUT"]); err == nil {
+		probe.timeout = v
+	}
+	if v, err := strconv.Atoi(labels["EXECUTOR_HEALTHCHECK_RETRIES"]); err == nil {
+		// retries is the number of consecutive failures at which the
+		// container is reported unhealthy; 0 ("fail on first failure") is
+		// floored to 1, which reports on the first failure as well
+		probe.retries = v
+		if probe.retries < 1 {
+			probe.retries = 1
+		}
+	}
+	if v, err := time.ParseDuration(labels["EXECUTOR_HEALTHCHECK_START_PERIOD"]); err == nil {
+		probe.startPeriod = v
+	}
+	if v, err := strconv.Atoi(labels["EXECUTOR_HEALTHCHECK_EXPECTED_STATUS"]); err == nil {
+		probe.expectedStatus = v
+	}
+
+	return probe, true
+}
+
+// runHealthcheckLoop periodically runs probe against containerID until ctx
+// is canceled, publishing a HealthcheckStatus on every failed probe once the
+// number of consecutive failures has reached the configured retries
+func runHealthcheckLoop(ctx context.Context, c container.Containerizer, taskInfo *mesos.TaskInfo, containerID string, probe healthcheckProbe) {
+	// drop this container's series once its probe loop exits, otherwise
+	// healthcheckProbesTotal/healthcheckHealthy grow unbounded on a
+	// long-lived agent that runs many containers over time
+	defer func() {
+		healthcheckProbesTotal.DeleteLabelValues(containerID, "success")
+		healthcheckProbesTotal.DeleteLabelValues(containerID, "failure")
+		healthcheckHealthy.DeleteLabelValues(containerID)
+	}()
+
+	if probe.startPeriod > 0 {
+		select {
+		case <-time.After(probe.startPeriod):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	ticker := time.NewTicker(probe.interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := runHealthcheckProbe(ctx, c, containerID, probe)
+
+			outcome := "success"
+			if err != nil {
+				outcome = "failure"
+				failures++
+				logger.GetInstance().Warn("healthcheck probe failed",
+					zap.String("id", containerID), zap.Int("failures", failures), zap.Error(err))
+			} else {
+				failures = 0
+			}
+
+			healthcheckProbesTotal.WithLabelValues(containerID, outcome).Inc()
+
+			if failures == 0 {
+				healthcheckHealthy.WithLabelValues(containerID).Set(1)
+				continue
+			}
+
+			healthcheckHealthy.WithLabelValues(containerID).Set(0)
+
+			if failures >= probe.retries {
+				select {
+				case healthcheckStatusC <- HealthcheckStatus{ContainerID: containerID, TaskInfo: taskInfo, Reason: "healthcheck"}:
+				default:
+					logger.GetInstance().Warn("healthcheck status channel is full, dropping update", zap.String("id", containerID))
+				}
+			}
+		}
+	}
+}
+
+// runHealthcheckProbe runs a single probe of the configured kind against
+// containerID, returning a non-nil error if the probe failed or timed out
+func runHealthcheckProbe(ctx context.Context, c container.Containerizer, containerID string, probe healthcheckProbe) error {
+	probeCtx, cancel := context.WithTimeout(ctx, probe.timeout)
+	defer cancel()
+
+	switch probe.kind {
+	case "exec":
+		result := c.ContainerExec(probeCtx, containerID, probe.cmd)
+		select {
+		case err := <-result:
+			return err
+		case <-probeCtx.Done():
+			return probeCtx.Err()
+		}
+	case "tcp":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(probeCtx, "tcp", probe.target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http":
+		req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, probe.target, nil)
+		if err != nil {
+			return err
+		}
+
+		client := &http.Client{Timeout: probe.timeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != probe.expectedStatus {
+			return fmt.Errorf("unexpected status code %d, expected %d", resp.StatusCode, probe.expectedStatus)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown healthcheck type %q", probe.kind)
+	}
+}
@@ -0,0 +1,161 @@
+package hook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mesos/mesos-go/api/v1/lib"
+)
+
+func stringPtr(s string) *string { return &s }
+
+func taskInfoWithLabels(labels map[string]string) *mesos.TaskInfo {
+	ls := make([]mesos.Label, 0, len(labels))
+	for k, v := range labels {
+		ls = append(ls, mesos.Label{Key: k, Value: stringPtr(v)})
+	}
+
+	return &mesos.TaskInfo{Labels: &mesos.Labels{Labels: ls}}
+}
+
+func TestParseHealthcheckProbeNotConfigured(t *testing.T) {
+	_, ok := parseHealthcheckProbe(taskInfoWithLabels(nil))
+	if ok {
+		t.Error("expected ok=false when EXECUTOR_HEALTHCHECK_TYPE is absent")
+	}
+}
+
+func TestParseHealthcheckProbeReadsLabels(t *testing.T) {
+	taskInfo := taskInfoWithLabels(map[string]string{
+		"EXECUTOR_HEALTHCHECK_TYPE":            "http",
+		"EXECUTOR_HEALTHCHECK_URL":             "http://127.0.0.1:8080/health",
+		"EXECUTOR_HEALTHCHECK_INTERVAL":        "5s",
+		"EXECUTOR_HEALTHCHECK_TIMEOUT":         "2s",
+		"EXECUTOR_HEALTHCHECK_RETRIES":         "5",
+		"EXECUTOR_HEALTHCHECK_START_PERIOD":    "1s",
+		"EXECUTOR_HEALTHCHECK_EXPECTED_STATUS": "201",
+	})
+
+	probe, ok := parseHealthcheckProbe(taskInfo)
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+
+	if probe.kind != "http" {
+		t.Errorf("kind = %q, want %q", probe.kind, "http")
+	}
+	if probe.target != "http://127.0.0.1:8080/health" {
+		t.Errorf("target = %q, want the configured URL", probe.target)
+	}
+	if probe.interval != 5*time.Second {
+		t.Errorf("interval = %v, want 5s", probe.interval)
+	}
+	if probe.timeout != 2*time.Second {
+		t.Errorf("timeout = %v, want 2s", probe.timeout)
+	}
+	if probe.retries != 5 {
+		t.Errorf("retries = %d, want 5", probe.retries)
+	}
+	if probe.startPeriod != time.Second {
+		t.Errorf("startPeriod = %v, want 1s", probe.startPeriod)
+	}
+	if probe.expectedStatus != 201 {
+		t.Errorf("expectedStatus = %d, want 201", probe.expectedStatus)
+	}
+}
+
+func TestParseHealthcheckProbeFloorsZeroRetries(t *testing.T) {
+	taskInfo := taskInfoWithLabels(map[string]string{
+		"EXECUTOR_HEALTHCHECK_TYPE":    "tcp",
+		"EXECUTOR_HEALTHCHECK_RETRIES": "0",
+	})
+
+	probe, ok := parseHealthcheckProbe(taskInfo)
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+
+	if probe.retries != 1 {
+		t.Errorf("retries = %d, want 1 (0 should be floored so \"fail on first failure\" is reachable)", probe.retries)
+	}
+}
+
+func TestParseHealthcheckProbeDefaultsRetries(t *testing.T) {
+	taskInfo := taskInfoWithLabels(map[string]string{
+		"EXECUTOR_HEALTHCHECK_TYPE": "tcp",
+	})
+
+	probe, ok := parseHealthcheckProbe(taskInfo)
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+
+	if probe.retries != defaultHealthcheckRetries {
+		t.Errorf("retries = %d, want default %d", probe.retries, defaultHealthcheckRetries)
+	}
+}
+
+func TestRunHealthcheckProbeTCPSuccess(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	probe := healthcheckProbe{kind: "tcp", target: ln.Addr().String(), timeout: time.Second}
+	if err := runHealthcheckProbe(context.Background(), nil, "c1", probe); err != nil {
+		t.Errorf("runHealthcheckProbe() = %v, want nil", err)
+	}
+}
+
+func TestRunHealthcheckProbeTCPFailure(t *testing.T) {
+	// nothing listens on this address
+	probe := healthcheckProbe{kind: "tcp", target: "127.0.0.1:1", timeout: 200 * time.Millisecond}
+	if err := runHealthcheckProbe(context.Background(), nil, "c1", probe); err == nil {
+		t.Error("runHealthcheckProbe() = nil, want an error for a closed port")
+	}
+}
+
+func TestRunHealthcheckProbeHTTPSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	probe := healthcheckProbe{kind: "http", target: server.URL, timeout: time.Second, expectedStatus: http.StatusOK}
+	if err := runHealthcheckProbe(context.Background(), nil, "c1", probe); err != nil {
+		t.Errorf("runHealthcheckProbe() = %v, want nil", err)
+	}
+}
+
+func TestRunHealthcheckProbeHTTPUnexpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	probe := healthcheckProbe{kind: "http", target: server.URL, timeout: time.Second, expectedStatus: http.StatusOK}
+	if err := runHealthcheckProbe(context.Background(), nil, "c1", probe); err == nil {
+		t.Error("runHealthcheckProbe() = nil, want an error on unexpected status code")
+	}
+}
+
+func TestRunHealthcheckProbeUnknownKind(t *testing.T) {
+	probe := healthcheckProbe{kind: "bogus", timeout: time.Second}
+	if err := runHealthcheckProbe(context.Background(), nil, "c1", probe); err == nil {
+		t.Error("runHealthcheckProbe() = nil, want an error for an unknown probe kind")
+	}
+}
@@ -0,0 +1,22 @@
+package hook
+
+import (
+	"go-mesos-executor/container"
+
+	"github.com/mesos/mesos-go/api/v1/lib"
+)
+
+// Hook represents a lifecycle hook that can run at one or several steps of
+// a task/container life: pre-create, pre-run, post-run, pre-stop, post-stop.
+// Hooks with a higher Priority run first among hooks registered for the
+// same step.
+type Hook struct {
+	Name     string
+	Priority int
+
+	RunPreCreate func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo) error
+	RunPreRun    func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error
+	RunPostRun   func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error
+	RunPreStop   func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error
+	RunPostStop  func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"go-mesos-executor/container"
+	"go-mesos-executor/errdefs"
 	"go-mesos-executor/logger"
 
 	"github.com/mesos/mesos-go/api/v1/lib"
@@ -21,6 +22,14 @@ import (
 type Manager struct {
 	EnabledHooks map[string]struct{}
 	Hooks        []*Hook
+
+	// HealthcheckStatusC receives an update each time a container started by
+	// HealthcheckHook crosses its configured retries threshold
+	HealthcheckStatusC <-chan HealthcheckStatus
+
+	// plugins holds the out-of-process hooks loaded from hooks.plugin_dir,
+	// so they can be terminated on Shutdown
+	plugins []*plugin
 }
 
 // sorter is a sort interface implementation in order to sort hooks
@@ -32,11 +41,12 @@ type sorter struct {
 type when string
 
 const (
-	preCreate = "pre-create"
-	preRun    = "pre-run"
-	postRun   = "post-run"
-	preStop   = "pre-stop"
-	postStop  = "post-stop"
+	preCreate   = "pre-create"
+	preRun      = "pre-run"
+	postRun     = "post-run"
+	preStop     = "pre-stop"
+	postStop    = "post-stop"
+	healthCheck = "health-check"
 )
 
 // Len is part of the sort interface
@@ -54,16 +64,23 @@ func (s *sorter) Swap(i, j int) {
 	s.hooks[i], s.hooks[j] = s.hooks[j], s.hooks[i]
 }
 
-// NewManager returns an empty HookManager (with no hooks)
+// NewManager returns a HookManager with no built-in hooks registered yet
+// (use RegisterHooks for that), but with every external hook plugin found
+// under hooks.plugin_dir already spawned and registered
 func NewManager(hooks []string) *Manager {
 	enabledHooks := make(map[string]struct{})
 	for _, hook := range hooks {
 		enabledHooks[hook] = struct{}{}
 	}
 
-	return &Manager{
-		EnabledHooks: enabledHooks,
+	m := &Manager{
+		EnabledHooks:       enabledHooks,
+		HealthcheckStatusC: HealthcheckStatusC,
 	}
+
+	m.loadPluginHooks()
+
+	return m
 }
 
 // sort sorts all slices using the given by function
@@ -161,7 +178,7 @@ func (m *Manager) runHooks(w when, c container.Containerizer, taskInfo *mesos.Ta
 
 			err = hook.RunPostStop(c, taskInfo, frameworkInfo, containerID)
 		default:
-			return fmt.Errorf("")
+			return errdefs.InvalidParameter(fmt.Errorf("unknown hook type %q", w))
 		}
 
 		if err != nil {
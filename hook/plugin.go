@@ -0,0 +1,262 @@
+package hook
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-mesos-executor/container"
+	"go-mesos-executor/errdefs"
+	"go-mesos-executor/logger"
+
+	"github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// defaultPluginTimeout is used for a plugin call when hooks.plugin_timeout is not set
+const defaultPluginTimeout = 5 * time.Second
+
+// pluginRequest is sent to a plugin over its stdin, one JSON object per line
+type pluginRequest struct {
+	When          when                 `json:"when"`
+	TaskInfo      *mesos.TaskInfo      `json:"task_info,omitempty"`
+	FrameworkInfo *mesos.FrameworkInfo `json:"framework_info,omitempty"`
+	ContainerID   string               `json:"container_id,omitempty"`
+}
+
+// pluginResponse is read back from the plugin's stdout, one JSON object per line.
+// Error is empty on success
+type pluginResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// plugin wraps a hook plugin process, speaking a JSON-over-stdio protocol:
+// every call writes one pluginRequest line to stdin and reads one
+// pluginResponse line back from stdout. Calls are serialized since the
+// protocol is not multiplexed
+type plugin struct {
+	name string
+	cmd  *exec.Cmd
+
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	timeout time.Duration
+	mu      sync.Mutex
+}
+
+// newPlugin spawns the plugin executable at path and health-checks it before
+// returning, so that a misbehaving plugin is caught at load time rather than
+// on the first real hook invocation
+func newPlugin(path string, timeout time.Duration) (*plugin, error) {
+	cmd := exec.Command(path)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, errdefs.Unavailable(err)
+	}
+
+	p := &plugin{
+		name:    filepath.Base(path),
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		timeout: timeout,
+	}
+
+	go p.captureStderr(stderr)
+
+	if err := p.call(pluginRequest{When: healthCheck}); err != nil {
+		p.stop()
+		return nil, fmt.Errorf("plugin %s failed health-check: %v", p.name, err)
+	}
+
+	return p, nil
+}
+
+// captureStderr forwards everything the plugin writes to its stderr to the
+// executor's logger, so that plugin misbehavior shows up alongside built-in
+// hook logs
+func (p *plugin) captureStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.GetInstance().Warn(scanner.Text(), zap.String("plugin", p.name))
+	}
+}
+
+// call sends req to the plugin and waits for its response, enforcing the
+// configured per-call timeout. A panic raised while calling the plugin is
+// reported as a regular hook error instead of crashing the executor; a
+// failed write to the plugin's stdin is returned as an ErrUnavailable
+func (p *plugin) call(req pluginRequest) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errdefs.System(fmt.Errorf("hook plugin %s panicked: %v", p.name, r))
+		}
+	}()
+
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+
+	if _, err := p.stdin.Write(append(encoded, '\n')); err != nil {
+		return errdefs.Unavailable(fmt.Errorf("hook plugin %s is unreachable: %v", p.name, err))
+	}
+
+	type callResult struct {
+		resp pluginResponse
+		err  error
+	}
+
+	done := make(chan callResult, 1)
+	go func() {
+		line, err := p.stdout.ReadString('\n')
+		if err != nil {
+			done <- callResult{err: err}
+			return
+		}
+
+		var resp pluginResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			done <- callResult{err: err}
+			return
+		}
+
+		done <- callResult{resp: resp}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return errdefs.Unavailable(fmt.Errorf("hook plugin %s response error: %v", p.name, r.err))
+		}
+		if r.resp.Error != "" {
+			return fmt.Errorf("%s", r.resp.Error)
+		}
+		return nil
+	case <-time.After(p.timeout):
+		return errdefs.Unavailable(fmt.Errorf("hook plugin %s timed out after %s", p.name, p.timeout))
+	}
+}
+
+// stop terminates the plugin process
+func (p *plugin) stop() {
+	p.stdin.Close()
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+	p.cmd.Wait()
+}
+
+// hookFromPlugin synthesizes a *Hook whose Run* closures forward every
+// invocation to the plugin process
+func hookFromPlugin(p *plugin, priority int) *Hook {
+	forward := func(w when) func(container.Containerizer, *mesos.TaskInfo, *mesos.FrameworkInfo, string) error {
+		return func(_ container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error {
+			return p.call(pluginRequest{When: w, TaskInfo: taskInfo, FrameworkInfo: frameworkInfo, ContainerID: containerID})
+		}
+	}
+
+	return &Hook{
+		Name:     p.name,
+		Priority: priority,
+		RunPreCreate: func(_ container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo) error {
+			return p.call(pluginRequest{When: preCreate, TaskInfo: taskInfo, FrameworkInfo: frameworkInfo})
+		},
+		RunPreRun:   forward(preRun),
+		RunPostRun:  forward(postRun),
+		RunPreStop:  forward(preStop),
+		RunPostStop: forward(postStop),
+	}
+}
+
+// loadPluginHooks scans hooks.plugin_dir for executable plugins, spawns and
+// health-checks each one, then registers a synthesized *Hook for it ordered
+// by hooks.plugin_priority. A plugin that fails to start or its health-check
+// is skipped with a logged error rather than failing the whole executor
+func (m *Manager) loadPluginHooks() {
+	dir := viper.GetString("hooks.plugin_dir")
+	if dir == "" {
+		return
+	}
+
+	priorities := viper.GetStringMapString("hooks.plugin_priority")
+
+	timeout := viper.GetDuration("hooks.plugin_timeout")
+	if timeout == 0 {
+		timeout = defaultPluginTimeout
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.GetInstance().Error("could not scan hooks plugin directory", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		p, err := newPlugin(path, timeout)
+		if err != nil {
+			logger.GetInstance().Error("could not start hook plugin", zap.String("plugin", entry.Name()), zap.Error(err))
+			continue
+		}
+
+		priority := 0
+		if v, ok := priorities[p.name]; ok {
+			if parsed, err := strconv.Atoi(v); err == nil {
+				priority = parsed
+			}
+		}
+
+		m.plugins = append(m.plugins, p)
+		m.Hooks = append(m.Hooks, hookFromPlugin(p, priority))
+
+		logger.GetInstance().Info("loaded hook plugin", zap.String("plugin", p.name), zap.Int("priority", priority))
+	}
+
+	m.sortByPriority()
+}
+
+// Shutdown terminates every loaded hook plugin. It should be called on
+// executor exit
+func (m *Manager) Shutdown() {
+	for _, p := range m.plugins {
+		p.stop()
+	}
+}
@@ -0,0 +1,108 @@
+package hook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"go-mesos-executor/errdefs"
+)
+
+// newTestPlugin wires up a plugin backed by in-memory pipes instead of a
+// real subprocess, so the JSON-over-stdio protocol can be exercised without
+// spawning a binary. respond is run in its own goroutine and plays the role
+// of the plugin process: it reads the request line written by call and
+// writes back whatever response it wants.
+func newTestPlugin(t *testing.T, timeout time.Duration, respond func(req pluginRequest, stdout io.Writer)) *plugin {
+	t.Helper()
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	t.Cleanup(func() {
+		stdinW.Close()
+		stdoutW.Close()
+	})
+
+	go func() {
+		reader := bufio.NewReader(stdinR)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var req pluginRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return
+		}
+
+		respond(req, stdoutW)
+	}()
+
+	return &plugin{
+		name:    "test-plugin",
+		stdin:   stdinW,
+		stdout:  bufio.NewReader(stdoutR),
+		timeout: timeout,
+	}
+}
+
+func writeResponse(t *testing.T, w io.Writer, resp pluginResponse) {
+	t.Helper()
+
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	if _, err := w.Write(append(encoded, '\n')); err != nil {
+		t.Fatalf("write response: %v", err)
+	}
+}
+
+func TestPluginCallSuccess(t *testing.T) {
+	p := newTestPlugin(t, time.Second, func(req pluginRequest, stdout io.Writer) {
+		if req.When != preRun {
+			t.Errorf("got When %q, want %q", req.When, preRun)
+		}
+		writeResponse(t, stdout, pluginResponse{})
+	})
+
+	if err := p.call(pluginRequest{When: preRun}); err != nil {
+		t.Errorf("call() = %v, want nil", err)
+	}
+}
+
+func TestPluginCallPropagatesPluginError(t *testing.T) {
+	p := newTestPlugin(t, time.Second, func(req pluginRequest, stdout io.Writer) {
+		writeResponse(t, stdout, pluginResponse{Error: "probe failed"})
+	})
+
+	err := p.call(pluginRequest{When: preRun})
+	if err == nil || err.Error() != "probe failed" {
+		t.Errorf("call() = %v, want \"probe failed\"", err)
+	}
+}
+
+func TestPluginCallTimesOut(t *testing.T) {
+	p := newTestPlugin(t, 10*time.Millisecond, func(req pluginRequest, stdout io.Writer) {
+		// never respond, forcing call to hit its timeout
+	})
+
+	err := p.call(pluginRequest{When: preRun})
+	if !errdefs.IsUnavailable(err) {
+		t.Errorf("call() = %v, want an ErrUnavailable", err)
+	}
+}
+
+func TestPluginCallRejectsMalformedResponse(t *testing.T) {
+	p := newTestPlugin(t, time.Second, func(req pluginRequest, stdout io.Writer) {
+		stdout.Write([]byte("not json\n"))
+	})
+
+	err := p.call(pluginRequest{When: preRun})
+	if !errdefs.IsUnavailable(err) {
+		t.Errorf("call() = %v, want an ErrUnavailable", err)
+	}
+}
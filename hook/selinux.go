@@ -0,0 +1,165 @@
+package hook
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"go-mesos-executor/container"
+	"go-mesos-executor/errdefs"
+	"go-mesos-executor/logger"
+
+	"github.com/mesos/mesos-go/api/v1/lib"
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var selinuxVolumeLabel = regexp.MustCompile("EXECUTOR_(?P<volumeIndex>[0-9]+)_SELINUX")
+
+// selinuxLabelPair is the process/mount label allocated for a single task by
+// RunPreCreate. Both are kept so RunPostStop can release the exact label
+// that was allocated, instead of allocating (and leaking) a fresh one
+type selinuxLabelPair struct {
+	processLabel string
+	mountLabel   string
+	// allocated is false when the pair came from the static
+	// security.selinux_label config rather than label.InitLabels, in which
+	// case there is no per-container MCS category to release
+	allocated bool
+}
+
+// selinuxLabels tracks the label allocated for each in-flight task between
+// RunPreCreate and RunPostStop, keyed by task ID since no container ID has
+// been assigned yet when RunPreCreate runs. It follows the same
+// register-on-start/consume-on-stop pattern as healthchecks in healthcheck.go
+var selinuxLabels = &selinuxLabelRegistry{labels: make(map[string]selinuxLabelPair)}
+
+type selinuxLabelRegistry struct {
+	mu     sync.Mutex
+	labels map[string]selinuxLabelPair
+}
+
+func (r *selinuxLabelRegistry) set(taskID string, pair selinuxLabelPair) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.labels[taskID] = pair
+}
+
+// get returns the label pair allocated for taskID, if any, without
+// forgetting it
+func (r *selinuxLabelRegistry) get(taskID string) (selinuxLabelPair, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair, ok := r.labels[taskID]
+	return pair, ok
+}
+
+// take returns and forgets the label pair allocated for taskID, if any
+func (r *selinuxLabelRegistry) take(taskID string) (selinuxLabelPair, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair, ok := r.labels[taskID]
+	delete(r.labels, taskID)
+	return pair, ok
+}
+
+// SELinuxLabels returns the process and mount labels RunPreCreate allocated
+// for taskInfo, for the caller to set on container.Info.ProcessLabel and
+// container.Info.MountLabel before calling Containerizer.ContainerCreate.
+// It returns ok=false if the selinux hook did not run for this task.
+func SELinuxLabels(taskInfo *mesos.TaskInfo) (processLabel, mountLabel string, ok bool) {
+	pair, ok := selinuxLabels.get(taskInfo.GetTaskID().GetValue())
+	return pair.processLabel, pair.mountLabel, ok
+}
+
+// SELinuxHook allocates the SELinux process/mount label for a task and
+// relabels any host volumes mounted into the container so that label can
+// access them. Volumes requesting a relabel are marked with an
+// EXECUTOR_<index>_SELINUX label whose value is "z" (shared, relabeled for
+// every container) or "Z" (private to this container), mirroring the
+// :z/:Z suffix docker volumes use. The allocated label is kept in
+// selinuxLabels (keyed by task ID, since no container ID exists yet at
+// pre-create) for SELinuxLabels to expose to the caller building
+// container.Info, and for RunPostStop to release
+var SELinuxHook = Hook{
+	Name:     "selinux",
+	Priority: 0,
+	RunPreCreate: func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo) error {
+		pair, err := allocateSELinuxLabels()
+		if err != nil {
+			return err
+		}
+
+		selinuxLabels.set(taskInfo.GetTaskID().GetValue(), pair)
+
+		volumes := taskInfo.GetContainer().GetVolumes()
+
+		for _, l := range taskInfo.GetLabels().GetLabels() {
+			match := selinuxVolumeLabel.FindStringSubmatch(l.GetKey())
+			// Ignore labels we do not care about
+			if match == nil {
+				continue
+			}
+
+			volumeIndex, err := strconv.Atoi(match[1])
+			if err != nil || volumeIndex >= len(volumes) {
+				return errdefs.InvalidParameter(fmt.Errorf("volume index in label %s is not valid", l.GetKey()))
+			}
+
+			var shared bool
+			switch l.GetValue() {
+			case "z":
+				shared = true
+			case "Z":
+				shared = false
+			default:
+				return errdefs.InvalidParameter(fmt.Errorf("unknown selinux volume mode %q, expected z or Z", l.GetValue()))
+			}
+
+			hostPath := volumes[volumeIndex].GetHostPath()
+			if err := label.Relabel(hostPath, pair.mountLabel, shared); err != nil {
+				logger.GetInstance().Error("selinux relabel failed", zap.String("path", hostPath), zap.Error(err))
+				return errdefs.System(err)
+			}
+
+			logger.GetInstance().Info("relabeled volume for selinux",
+				zap.String("path", hostPath), zap.String("label", pair.mountLabel), zap.Bool("shared", shared))
+		}
+
+		return nil
+	},
+	RunPostStop: func(c container.Containerizer, taskInfo *mesos.TaskInfo, frameworkInfo *mesos.FrameworkInfo, containerID string) error {
+		pair, ok := selinuxLabels.take(taskInfo.GetTaskID().GetValue())
+		if !ok || !pair.allocated {
+			// nothing was dynamically allocated for this task (RunPreCreate
+			// didn't run, or the label came from static config), so there is
+			// no MCS category to release
+			return nil
+		}
+
+		// release the exact MCS category pair allocated in RunPreCreate so
+		// it can be reused, avoiding category exhaustion on long-running agents
+		label.ReleaseLabel(pair.mountLabel)
+
+		return nil
+	},
+}
+
+// allocateSELinuxLabels returns the SELinux process/mount label pair to use
+// for a container, either the one configured in security.selinux_label
+// (applied to every container alike, so nothing needs releasing) or a
+// freshly allocated process/mount label pair from label.InitLabels
+func allocateSELinuxLabels() (selinuxLabelPair, error) {
+	if configured := viper.GetString("security.selinux_label"); configured != "" {
+		return selinuxLabelPair{processLabel: configured, mountLabel: configured}, nil
+	}
+
+	processLabel, mountLabel, err := label.InitLabels(nil)
+	if err != nil {
+		return selinuxLabelPair{}, errdefs.System(err)
+	}
+
+	return selinuxLabelPair{processLabel: processLabel, mountLabel: mountLabel, allocated: true}, nil
+}
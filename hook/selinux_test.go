@@ -0,0 +1,79 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSelinuxLabelRegistrySetGetTake(t *testing.T) {
+	r := &selinuxLabelRegistry{labels: make(map[string]selinuxLabelPair)}
+
+	if _, ok := r.get("task-1"); ok {
+		t.Fatal("expected get() on an empty registry to report ok=false")
+	}
+
+	pair := selinuxLabelPair{processLabel: "proc", mountLabel: "mount", allocated: true}
+	r.set("task-1", pair)
+
+	got, ok := r.get("task-1")
+	if !ok || got != pair {
+		t.Errorf("get() = %+v, %v, want %+v, true", got, ok, pair)
+	}
+
+	// get must not forget the entry
+	if _, ok := r.get("task-1"); !ok {
+		t.Error("expected a second get() to still find the entry")
+	}
+
+	taken, ok := r.take("task-1")
+	if !ok || taken != pair {
+		t.Errorf("take() = %+v, %v, want %+v, true", taken, ok, pair)
+	}
+
+	if _, ok := r.take("task-1"); ok {
+		t.Error("expected take() to forget the entry once consumed")
+	}
+}
+
+func TestSELinuxLabelsReadsRegistry(t *testing.T) {
+	taskInfo := taskInfoWithLabels(nil)
+	taskInfo.TaskID.Value = "task-selinux"
+
+	selinuxLabels.set("task-selinux", selinuxLabelPair{processLabel: "proc", mountLabel: "mount", allocated: true})
+	defer selinuxLabels.take("task-selinux")
+
+	processLabel, mountLabel, ok := SELinuxLabels(taskInfo)
+	if !ok {
+		t.Fatal("expected ok=true for a registered task")
+	}
+	if processLabel != "proc" || mountLabel != "mount" {
+		t.Errorf("got (%q, %q), want (\"proc\", \"mount\")", processLabel, mountLabel)
+	}
+}
+
+func TestSELinuxLabelsMissingTask(t *testing.T) {
+	taskInfo := taskInfoWithLabels(nil)
+	taskInfo.TaskID.Value = "task-never-registered"
+
+	if _, _, ok := SELinuxLabels(taskInfo); ok {
+		t.Error("expected ok=false for a task that never ran through RunPreCreate")
+	}
+}
+
+func TestAllocateSELinuxLabelsUsesConfiguredLabel(t *testing.T) {
+	viper.Set("security.selinux_label", "system_u:object_r:container_file_t:s0")
+	defer viper.Set("security.selinux_label", "")
+
+	pair, err := allocateSELinuxLabels()
+	if err != nil {
+		t.Fatalf("allocateSELinuxLabels() error = %v", err)
+	}
+
+	if pair.processLabel != "system_u:object_r:container_file_t:s0" || pair.mountLabel != "system_u:object_r:container_file_t:s0" {
+		t.Errorf("got %+v, want both labels set to the configured value", pair)
+	}
+	if pair.allocated {
+		t.Error("a statically configured label should not be marked as dynamically allocated")
+	}
+}